@@ -12,14 +12,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"code.cloudfoundry.org/bytefmt"
+	"github.com/agalue/newts-sizing/pkg/report"
+	"github.com/agalue/newts-sizing/pkg/rrdfile"
+	"github.com/agalue/newts-sizing/pkg/rrdpath"
 	"github.com/karrick/godirwalk"
 	"github.com/urfave/cli"
 )
@@ -28,15 +29,6 @@ import (
 const dsProperties = "ds.properties"
 const stringsProperties = "strings.properties"
 
-// To identify RRD or JRB files
-var rrdRegExp = regexp.MustCompile(`\.(rrd|jrb)$`)
-
-// To identify node directories (Collectd), regardless if storeByForeignSource is enabled
-var nodeRegExp = regexp.MustCompile(`snmp\/(\d+|fs\/[^\/]+\/[^\/]+)\/`)
-
-// To identify response time directories (Pollerd)
-var intfRegExp = regexp.MustCompile(`response\/([\d.]+)\/`)
-
 var debug = false
 
 // Command analyses the RRD/JRB directory to produce metrics estimates
@@ -64,6 +56,22 @@ var Command = cli.Command{
 			Name:  "debug, d",
 			Usage: "To show debug information while processing the data directory",
 		},
+		cli.StringFlag{
+			Name:  "report, j",
+			Usage: "Path to write a JSON report so that `sizing size --report` can auto-fill --sample-size, --interval and --total-metrics",
+		},
+		cli.StringFlag{
+			Name:  "metrics-listen",
+			Usage: "Address to expose live Prometheus/OpenMetrics counters and gauges on, e.g. :9109",
+		},
+		cli.StringFlag{
+			Name:  "push-gateway",
+			Usage: "Prometheus Pushgateway URL to push results to once the analysis completes, for cron use",
+		},
+		cli.DurationFlag{
+			Name:  "repeat",
+			Usage: "Re-run the analysis on this schedule instead of exiting after the first pass, e.g. 1h",
+		},
 	},
 }
 
@@ -76,6 +84,10 @@ type metrics struct {
 	resourceMap         map[string]int
 	interfaceMap        map[string]int
 	totalSizeInBytes    int64
+	sampleSizeSum       int64
+	sampleSizeCount     int64
+	stepSumMinutes      float64
+	stepCount           int64
 	mu                  sync.Mutex
 }
 
@@ -121,26 +133,51 @@ func (m *metrics) addResource(r string) {
 	m.mu.Unlock()
 }
 
-func (m *metrics) printSortedMap(data map[string]int) {
-	var keys []string
-	for k := range data {
-		keys = append(keys, k)
+func (m *metrics) addSampleSize(size int64) {
+	if size <= 0 {
+		return
 	}
-	sort.Strings(keys)
-	for i, k := range keys {
-		fmt.Printf(" %8d: %s (%d)\n", (i + 1), k, data[k])
+	m.mu.Lock()
+	m.sampleSizeSum += size
+	m.sampleSizeCount++
+	m.mu.Unlock()
+}
+
+func (m *metrics) addStep(step time.Duration) {
+	if step <= 0 {
+		return
+	}
+	m.mu.Lock()
+	m.stepSumMinutes += step.Minutes()
+	m.stepCount++
+	m.mu.Unlock()
+}
+
+// averageSampleSize returns the mean on-disk bytes-per-sample observed across the parsed RRD/JRB headers
+func (m *metrics) averageSampleSize() float64 {
+	if m.sampleSizeCount == 0 {
+		return 0
+	}
+	return float64(m.sampleSizeSum) / float64(m.sampleSizeCount)
+}
+
+// averageStepMinutes returns the mean collection interval, in minutes, observed across the parsed RRD/JRB headers
+func (m *metrics) averageStepMinutes() float64 {
+	if m.stepCount == 0 {
+		return 0
 	}
+	return m.stepSumMinutes / float64(m.stepCount)
 }
 
 func (m *metrics) printResults() {
 	if m.debug {
 		fmt.Println()
 		fmt.Println("Nodes:")
-		m.printSortedMap(m.nodeMap)
+		rrdpath.PrintSortedMap(m.nodeMap)
 		fmt.Println("IP Interfaces:")
-		m.printSortedMap(m.interfaceMap)
+		rrdpath.PrintSortedMap(m.interfaceMap)
 		fmt.Println("Resources:")
-		m.printSortedMap(m.resourceMap)
+		rrdpath.PrintSortedMap(m.resourceMap)
 		fmt.Println()
 	}
 	fmt.Printf("Number of Nodes = %d\n", len(m.nodeMap))
@@ -154,10 +191,51 @@ func (m *metrics) printResults() {
 	// find /opennms-data/rrd -name ds.properties -exec cat {} \; | grep -v "^[#]" | wc -l
 	fmt.Printf("Number of Numeric Metrics = %d\n", m.numOfNumericMetrics)
 	fmt.Printf("Total Size in Bytes = %s\n", bytefmt.ByteSize(uint64(m.totalSizeInBytes)))
+	if m.sampleSizeCount > 0 {
+		fmt.Printf("Average Sample Size (from RRD/JRB headers) = %.2f bytes\n", m.averageSampleSize())
+	}
+	if m.stepCount > 0 {
+		fmt.Printf("Average Collection Interval (from RRD/JRB headers) = %.2f minutes\n", m.averageStepMinutes())
+	}
 }
 
 func analyze(c *cli.Context) error {
 	log.SetOutput(os.Stdout)
+	repeat := c.Duration("repeat")
+
+	// Always constructed, even when --metrics-listen is unset, so that --push-gateway (which has no
+	// listener of its own) still pushes the counters/gauges runOnce populated during the walk
+	prom := newPromMetrics()
+	if listenAddr := c.String("metrics-listen"); listenAddr != "" {
+		prom.listen(listenAddr)
+		fmt.Printf("Exposing Prometheus/OpenMetrics on %s/metrics\n", listenAddr)
+	}
+
+	for {
+		if err := runOnce(c, prom); err != nil {
+			if repeat <= 0 {
+				return err
+			}
+			// Long-running mode: log and keep serving metrics/retrying on the next cycle instead
+			// of tearing down the process (and its metrics server) over one transient walk error
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		}
+		if pushGateway := c.String("push-gateway"); pushGateway != "" {
+			if err := prom.pushOnce(pushGateway); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: unable to push to %s: %s\n", pushGateway, err)
+			}
+		}
+		if repeat <= 0 {
+			return nil
+		}
+		fmt.Printf("Sleeping for %s before the next analysis...\n", repeat)
+		time.Sleep(repeat)
+	}
+}
+
+// runOnce performs a single pass over the RRD directory, printing and optionally reporting the results
+func runOnce(c *cli.Context, prom *promMetrics) error {
+	start := time.Now()
 	rrdDir := c.String("rrd-dir")
 	newerThan := c.Duration("newer-than")
 	singleMetric := c.Bool("single-metric")
@@ -197,19 +275,23 @@ func analyze(c *cli.Context) error {
 				return nil
 			}
 			// Process only RRD/JRB files
-			if isRRD(path) {
+			if rrdpath.IsRRD(path) {
+				if prom != nil {
+					prom.filesScanned.Inc()
+					prom.bytesTotal.Add(float64(stat.Size()))
+				}
 				if !singleMetric {
 					data.incGroups()
 				}
 				data.addSize(stat.Size())
-				data.addNumeric(countNumericMetrics(path, singleMetric))
+				data.addNumeric(countNumericMetrics(path, singleMetric, &data))
 				data.addResource(filepath.Base(path))
 				// Count unique nodes
-				if nodeData := nodeRegExp.FindStringSubmatch(path); len(nodeData) == 2 {
+				if nodeData := rrdpath.NodeRegExp.FindStringSubmatch(path); len(nodeData) == 2 {
 					data.addNode(nodeData[1])
 				}
 				// Count unique IP interfaces (response time resources from Pollerd)
-				if intfData := intfRegExp.FindStringSubmatch(path); len(intfData) == 2 {
+				if intfData := rrdpath.IntfRegExp.FindStringSubmatch(path); len(intfData) == 2 {
 					data.addIntf(intfData[1])
 				}
 			}
@@ -226,27 +308,54 @@ func analyze(c *cli.Context) error {
 		FollowSymbolicLinks: true,
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+		// Returned to the caller rather than os.Exit'd: under --repeat/--metrics-listen this is a
+		// long-running process, and a transient walk error shouldn't kill it or its metrics server
+		return fmt.Errorf("unable to walk %s: %w", rrdDir, err)
 	}
 
 	// Print the results
 	data.printResults()
+
+	if prom != nil {
+		prom.numericMetrics.Set(float64(data.numOfNumericMetrics))
+		prom.stringMetrics.Set(float64(data.numOfStringMetrics))
+		prom.groups.Set(float64(data.numOfGroups))
+		prom.walkDurationSeconds.Set(time.Since(start).Seconds())
+		prom.lastSuccessTimestamp.Set(float64(time.Now().Unix()))
+	}
+
+	// Optionally write a JSON report so `sizing size --report` can auto-fill its flags
+	if reportPath := c.String("report"); reportPath != "" {
+		totalMetrics := float64(data.numOfNumericMetrics + data.numOfStringMetrics)
+		r := &report.Report{
+			TotalMetrics:      totalMetrics,
+			AverageSampleSize: data.averageSampleSize(),
+			IntervalMinutes:   data.averageStepMinutes(),
+		}
+		if err := report.Write(reportPath, r); err != nil {
+			return fmt.Errorf("unable to write report to %s: %w", reportPath, err)
+		}
+		fmt.Printf("Report written to %s\n", reportPath)
+	}
 	return nil
 }
 
-// Returns true if the path is associated with an RRD or JRB file
-func isRRD(path string) bool {
-	return rrdRegExp.MatchString(path)
-}
+// Returns the total number of numeric metrics on a given RRD/JRB file, preferring the real DS
+// count read from the file's own header over the ds.properties/--single-metric heuristics
+func countNumericMetrics(path string, singleMetric bool, data *metrics) int {
+	if rrd, err := rrdfile.Parse(path); err == nil {
+		count := rrd.NumericDSCount()
+		data.addSampleSize(rrd.SampleSize)
+		data.addStep(rrd.Step)
+		info(fmt.Sprintf("There are %d numeric metrics for %s according to its %s header", count, path, rrd.Format))
+		return count
+	}
 
-// Returns the total number of numeric metrics on a given RRD/JRB file assuming storeByGroup
-func countNumericMetrics(path string, singleMetric bool) int {
 	if singleMetric {
 		info(fmt.Sprintf("Assuming single metric per RRD/JRB files for %s", path))
 		return 1 // Assumning single metric
 	}
-	resource := rrdRegExp.ReplaceAllString(filepath.Base(path), "")
+	resource := rrdpath.RRDRegExp.ReplaceAllString(filepath.Base(path), "")
 	dsFile := fmt.Sprintf("%s/%s", filepath.Dir(path), dsProperties)
 	properties := getProperties(dsFile)
 	count := 0
@@ -286,15 +395,6 @@ func getProperties(path string) map[string]string {
 	return properties
 }
 
-// Verify if a given file exists on disk
-func fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
-	}
-	return !info.IsDir()
-}
-
 // Returns true if a given text is a number
 func isNum(text string) bool {
 	if _, err := strconv.Atoi(text); err == nil {
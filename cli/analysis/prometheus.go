@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// promMetrics holds the Prometheus/OpenMetrics collectors that --metrics-listen and
+// --push-gateway expose, so that progress and results can be tracked on long-running or
+// scheduled invocations (in combination with --repeat)
+type promMetrics struct {
+	registry             *prometheus.Registry
+	filesScanned         prometheus.Counter
+	bytesTotal           prometheus.Counter
+	numericMetrics       prometheus.Gauge
+	stringMetrics        prometheus.Gauge
+	groups               prometheus.Gauge
+	walkDurationSeconds  prometheus.Gauge
+	lastSuccessTimestamp prometheus.Gauge
+}
+
+func newPromMetrics() *promMetrics {
+	m := &promMetrics{
+		registry: prometheus.NewRegistry(),
+		filesScanned: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "newts_analysis_files_scanned_total",
+			Help: "Total number of RRD/JRB files scanned so far",
+		}),
+		bytesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "newts_analysis_bytes_total",
+			Help: "Total size in bytes of the RRD/JRB files scanned so far",
+		}),
+		numericMetrics: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "newts_analysis_numeric_metrics",
+			Help: "Number of numeric metrics found by the current/last analysis",
+		}),
+		stringMetrics: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "newts_analysis_string_metrics",
+			Help: "Number of string metrics found by the current/last analysis",
+		}),
+		groups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "newts_analysis_groups",
+			Help: "Number of groups (Newts resources) found by the current/last analysis",
+		}),
+		walkDurationSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "newts_analysis_walk_duration_seconds",
+			Help: "Duration in seconds of the last directory walk",
+		}),
+		lastSuccessTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "newts_analysis_last_success_timestamp_seconds",
+			Help: "Unix timestamp of the last successful analysis",
+		}),
+	}
+	m.registry.MustRegister(
+		m.filesScanned,
+		m.bytesTotal,
+		m.numericMetrics,
+		m.stringMetrics,
+		m.groups,
+		m.walkDurationSeconds,
+		m.lastSuccessTimestamp,
+	)
+	return m
+}
+
+// listen starts an HTTP server exposing the registry at /metrics in the background
+func (m *promMetrics) listen(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: metrics listener on %s failed: %s\n", addr, err)
+		}
+	}()
+}
+
+// pushOnce sends the current state of the registry to a Prometheus Pushgateway, for cron-style invocations
+func (m *promMetrics) pushOnce(url string) error {
+	return push.New(url, "newts_analysis").Gatherer(m.registry).Push()
+}
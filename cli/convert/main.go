@@ -0,0 +1,331 @@
+// Package convert contains a CLI to stream RRD/JRB data directly into Newts over the Cassandra CQL protocol.
+//
+// This is meant to be run after analysis/prune have been used to scope down the RRD directory to what's
+// actually worth migrating; it walks the same directory tree, reads consolidated data points out of each
+// file via pkg/rrdfile, and writes them to the Newts samples table in batches.
+//
+// @author Alejandro Galue <agalue@opennms.com>
+package convert
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agalue/newts-sizing/pkg/rrdfile"
+	"github.com/agalue/newts-sizing/pkg/rrdpath"
+	"github.com/gocql/gocql"
+	"github.com/karrick/godirwalk"
+	"github.com/urfave/cli"
+)
+
+// Number of seconds in a Newts partition; Newts shards samples by week, but the exact bucketing rule
+// lives in the server configuration and isn't derivable from the RRD files themselves, so this is an
+// explicit approximation rather than a value read from anywhere
+const partitionSizeSeconds = int64(7 * 24 * time.Hour / time.Second)
+
+var debug = false
+
+// Command converts RRD/JRB data into Newts via the Cassandra CQL protocol
+var Command = cli.Command{
+	Name:      "convert",
+	ShortName: "c",
+	Usage:     "Streams RRD/JRB data into Newts via the Cassandra CQL protocol",
+	Action:    convert,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "rrd-dir, r",
+			Usage: "The RRD/JRB directory",
+			Value: "/opt/opennms/share/rrd",
+		},
+		cli.DurationFlag{
+			Name:  "since, s",
+			Usage: "Only convert data points collected within this duration before now; ignored when --from is set",
+			Value: 24 * time.Hour,
+		},
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "Only convert data points collected at or after this time (RFC3339, e.g. 2020-01-01T00:00:00Z); overrides --since",
+		},
+		cli.StringFlag{
+			Name:  "to",
+			Usage: "Only convert data points collected at or before this time (RFC3339); defaults to now",
+		},
+		cli.StringFlag{
+			Name:  "consolidation-function, f",
+			Usage: "The RRA consolidation function to fetch samples from",
+			Value: "AVERAGE",
+		},
+		cli.StringFlag{
+			Name:  "context",
+			Usage: "The Newts context to write samples to",
+			Value: "newts",
+		},
+		cli.StringFlag{
+			Name:  "keyspace",
+			Usage: "The Cassandra/ScyllaDB keyspace holding the Newts tables",
+			Value: "newts",
+		},
+		cli.StringFlag{
+			Name:  "contact-points",
+			Usage: "Comma-separated list of Cassandra/ScyllaDB contact points",
+			Value: "127.0.0.1",
+		},
+		cli.BoolFlag{
+			Name:  "tls",
+			Usage: "Enable TLS when connecting to the cluster",
+		},
+		cli.BoolFlag{
+			Name:  "tls-skip-verify",
+			Usage: "Disable certificate/hostname verification when --tls is set; insecure, only for testing",
+		},
+		cli.IntFlag{
+			Name:  "batch-size, b",
+			Usage: "Number of samples per CQL batch insert",
+			Value: 100,
+		},
+		cli.IntFlag{
+			Name:  "concurrency, C",
+			Usage: "Number of batches to write concurrently",
+			Value: 4,
+		},
+		cli.BoolTFlag{
+			Name:  "dry-run, n",
+			Usage: "Print the samples that would be written instead of connecting to the cluster",
+		},
+		cli.BoolFlag{
+			Name:  "debug, d",
+			Usage: "To show debug information while processing the data directory",
+		},
+	},
+}
+
+// sample is a single Newts data point, ready to be written to the samples table
+type sample struct {
+	resource   string
+	metricName string
+	timestamp  time.Time
+	value      float64
+	partition  int64
+}
+
+func convert(c *cli.Context) error {
+	log.SetOutput(os.Stdout)
+	debug = c.Bool("debug")
+
+	rrdDir := c.String("rrd-dir")
+	cf := c.String("consolidation-function")
+	dryRun := c.BoolT("dry-run")
+	batchSize := c.Int("batch-size")
+	concurrency := c.Int("concurrency")
+
+	from, to, err := timeRange(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("RRD Directory = %s\n", rrdDir)
+	fmt.Printf("Converting samples between %s and %s using %s\n", from.Format("2006-01-02 15:04:05 MST"), to.Format("2006-01-02 15:04:05 MST"), cf)
+	fmt.Printf("Dry Run = %t\n", dryRun)
+	fmt.Println("...")
+
+	var writer sampleWriter
+	if dryRun {
+		writer = &dryRunWriter{}
+	} else {
+		session, err := newSession(c)
+		if err != nil {
+			return fmt.Errorf("unable to connect to the cluster: %w", err)
+		}
+		defer session.Close()
+		writer = &cqlWriter{session: session, keyspace: c.String("keyspace"), context: c.String("context")}
+	}
+
+	batches := make(chan []sample)
+	var wg sync.WaitGroup
+	var writeErr error
+	var errMu sync.Mutex
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := writer.write(batch); err != nil {
+					errMu.Lock()
+					if writeErr == nil {
+						writeErr = err
+					}
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var filesConverted int
+	var samplesConverted int64
+	pending := make([]sample, 0, batchSize)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		batch := make([]sample, len(pending))
+		copy(batch, pending)
+		batches <- batch
+		samplesConverted += int64(len(batch))
+		pending = pending[:0]
+	}
+
+	err = godirwalk.Walk(rrdDir, &godirwalk.Options{
+		Callback: func(path string, info *godirwalk.Dirent) error {
+			if info.IsDir() || !rrdpath.IsRRD(path) {
+				return nil
+			}
+			stat, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if stat.ModTime().Before(from) {
+				return nil
+			}
+
+			resource := resourceID(rrdDir, path)
+			points, err := rrdfile.Fetch(path, cf, from, to)
+			if err != nil {
+				debugf("skipping %s: %s", path, err)
+				return nil
+			}
+			for _, p := range points {
+				// RRA slots that haven't been filled yet come back as nan from rrdtool fetch;
+				// they aren't real samples and shouldn't be written to Newts
+				if math.IsNaN(p.Value) {
+					continue
+				}
+				pending = append(pending, sample{
+					resource:   resource,
+					metricName: p.DS,
+					timestamp:  p.Timestamp,
+					value:      p.Value,
+					partition:  p.Timestamp.Unix() / partitionSizeSeconds,
+				})
+				if len(pending) >= batchSize {
+					flush()
+				}
+			}
+			filesConverted++
+			return nil
+		},
+		ErrorCallback: func(osPathname string, err error) godirwalk.ErrorAction {
+			return godirwalk.SkipNode
+		},
+		Unsorted:            true,
+		FollowSymbolicLinks: true,
+	})
+	flush()
+	close(batches)
+	wg.Wait()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("unable to write samples: %w", writeErr)
+	}
+
+	fmt.Printf("Files Converted = %d\n", filesConverted)
+	fmt.Printf("Samples Converted = %d\n", samplesConverted)
+	return nil
+}
+
+// timeRange resolves the --from/--to/--since flags into a concrete [from, to] window; --from/--to
+// take precedence over --since so that an operator can migrate an arbitrary slice of history
+// instead of only "the last N hours up to now"
+func timeRange(c *cli.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := c.String("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --to %q: %w", v, err)
+		}
+		to = t
+	}
+
+	if v := c.String("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --from %q: %w", v, err)
+		}
+		return t, to, nil
+	}
+
+	return to.Add(-c.Duration("since")), to, nil
+}
+
+// resourceID derives a Newts resource identifier from an RRD/JRB file path, by taking its path
+// relative to rrdDir (minus the file extension) and joining the segments with ':', matching the
+// convention OpenNMS itself uses when mapping on-disk resources into Newts resource IDs
+func resourceID(rrdDir, path string) string {
+	rel, err := filepath.Rel(rrdDir, path)
+	if err != nil {
+		rel = path
+	}
+	rel = rrdpath.RRDRegExp.ReplaceAllString(rel, "")
+	return strings.ReplaceAll(rel, string(filepath.Separator), ":")
+}
+
+func debugf(format string, args ...interface{}) {
+	if debug {
+		log.Printf(format, args...)
+	}
+}
+
+// sampleWriter is implemented by both the real Cassandra/ScyllaDB writer and the --dry-run printer
+type sampleWriter interface {
+	write(batch []sample) error
+}
+
+// dryRunWriter prints the samples that would be written, in a compact line-protocol-style format
+type dryRunWriter struct {
+	mu sync.Mutex
+}
+
+func (w *dryRunWriter) write(batch []sample) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range batch {
+		fmt.Printf("resource=%s partition=%d %s=%g %d\n", s.resource, s.partition, s.metricName, s.value, s.timestamp.Unix())
+	}
+	return nil
+}
+
+// cqlWriter writes samples to the Newts samples table via gocql
+type cqlWriter struct {
+	session  *gocql.Session
+	keyspace string
+	context  string
+}
+
+func (w *cqlWriter) write(batch []sample) error {
+	b := w.session.NewBatch(gocql.UnloggedBatch)
+	query := fmt.Sprintf("INSERT INTO %s.samples (context, partition, resource, collected_at, metric_name, value) VALUES (?, ?, ?, ?, ?, ?)", w.keyspace)
+	for _, s := range batch {
+		b.Query(query, w.context, s.partition, s.resource, s.timestamp, s.metricName, s.value)
+	}
+	return w.session.ExecuteBatch(b)
+}
+
+// newSession builds a gocql session from the CLI flags
+func newSession(c *cli.Context) (*gocql.Session, error) {
+	contactPoints := strings.Split(c.String("contact-points"), ",")
+	cluster := gocql.NewCluster(contactPoints...)
+	cluster.Keyspace = c.String("keyspace")
+	if c.Bool("tls") {
+		cluster.SslOpts = &gocql.SslOptions{EnableHostVerification: !c.Bool("tls-skip-verify")}
+	}
+	return cluster.CreateSession()
+}
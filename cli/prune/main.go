@@ -0,0 +1,295 @@
+// Package prune contains a CLI to safely remove stale RRD/JRB files from the directory used by the analysis sub-command.
+//
+// This tool is meant to be used as part of an analyze -> prune -> re-analyze -> size cycle, so operators can shrink
+// the RRD directory before estimating how many resources will need to be migrated into Newts.
+//
+// @author Alejandro Galue <agalue@opennms.com>
+package prune
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/agalue/newts-sizing/pkg/rrdpath"
+	"github.com/karrick/godirwalk"
+	"github.com/urfave/cli"
+)
+
+// Define constants
+const dsProperties = "ds.properties"
+const stringsProperties = "strings.properties"
+
+var debug = false
+
+// Command prunes stale OpenNMS resources (directories holding RRD/JRB files) from the RRD directory
+var Command = cli.Command{
+	Name:      "prune",
+	ShortName: "p",
+	Usage:     "Safely deletes stale RRD/JRB files (and their sibling properties) from the RRD directory",
+	Action:    prune,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "rrd-dir, r",
+			Usage: "The RRD/JRB directory",
+			Value: "/opt/opennms/share/rrd",
+		},
+		cli.DurationFlag{
+			Name:  "older-than, o",
+			Usage: "Only consider resources whose newest RRD/JRB file is older than this duration",
+			Value: 90 * 24 * time.Hour,
+		},
+		cli.DurationFlag{
+			Name:  "min-age, m",
+			Usage: "Safety guard; refuses to run if --older-than is below this duration",
+			Value: 24 * time.Hour,
+		},
+		cli.StringFlag{
+			Name:  "include, i",
+			Usage: "Only consider resource paths matching this regular expression",
+		},
+		cli.StringFlag{
+			Name:  "exclude, e",
+			Usage: "Skip resource paths matching this regular expression",
+		},
+		cli.BoolTFlag{
+			Name:  "dry-run, n",
+			Usage: "Report what would be removed without deleting anything",
+		},
+		cli.BoolFlag{
+			Name:  "debug, d",
+			Usage: "To show debug information while processing the data directory",
+		},
+	},
+}
+
+// resource represents an OpenNMS resource directory that holds one or more RRD/JRB files
+type resource struct {
+	dir           string
+	files         []string
+	sizeInBytes   int64
+	newestModTime time.Time
+}
+
+type report struct {
+	debug            bool
+	resourcesScanned int
+	resourcesPruned  int
+	numOfGroups      int
+	bytesFreed       int64
+	nodeMap          map[string]int
+	interfaceMap     map[string]int
+	mu               sync.Mutex
+}
+
+func (r *report) incScanned() {
+	r.mu.Lock()
+	r.resourcesScanned++
+	r.mu.Unlock()
+}
+
+func (r *report) incPruned() {
+	r.mu.Lock()
+	r.resourcesPruned++
+	r.mu.Unlock()
+}
+
+func (r *report) incGroups() {
+	r.mu.Lock()
+	r.numOfGroups++
+	r.mu.Unlock()
+}
+
+func (r *report) addBytesFreed(size int64) {
+	r.mu.Lock()
+	r.bytesFreed += size
+	r.mu.Unlock()
+}
+
+func (r *report) addNode(n string) {
+	r.mu.Lock()
+	r.nodeMap[n]++
+	r.mu.Unlock()
+}
+
+func (r *report) addIntf(i string) {
+	r.mu.Lock()
+	r.interfaceMap[i]++
+	r.mu.Unlock()
+}
+
+func (r *report) printResults(dryRun bool) {
+	if r.debug {
+		fmt.Println()
+		fmt.Println("Nodes Impacted:")
+		rrdpath.PrintSortedMap(r.nodeMap)
+		fmt.Println("IP Interfaces Impacted:")
+		rrdpath.PrintSortedMap(r.interfaceMap)
+		fmt.Println()
+	}
+	fmt.Printf("Number of Resources Scanned = %d\n", r.resourcesScanned)
+	if dryRun {
+		fmt.Printf("Number of Resources that would be Pruned = %d\n", r.resourcesPruned)
+	} else {
+		fmt.Printf("Number of Resources Pruned = %d\n", r.resourcesPruned)
+	}
+	fmt.Printf("Number of Nodes Impacted = %d\n", len(r.nodeMap))
+	fmt.Printf("Number of IP Interfaces Impacted = %d\n", len(r.interfaceMap))
+	fmt.Printf("Number of Groups (Newts Resources) Removed = %d\n", r.numOfGroups)
+	if dryRun {
+		fmt.Printf("Total Bytes that would be Freed = %s\n", bytefmt.ByteSize(uint64(r.bytesFreed)))
+	} else {
+		fmt.Printf("Total Bytes Freed = %s\n", bytefmt.ByteSize(uint64(r.bytesFreed)))
+	}
+}
+
+func prune(c *cli.Context) error {
+	log.SetOutput(os.Stdout)
+	rrdDir := c.String("rrd-dir")
+	olderThan := c.Duration("older-than")
+	minAge := c.Duration("min-age")
+	dryRun := c.BoolT("dry-run")
+	debug = c.Bool("debug")
+
+	if olderThan < minAge {
+		return fmt.Errorf("refusing to run as --older-than (%s) is below the --min-age safety guard (%s)", olderThan, minAge)
+	}
+
+	var includeRegExp, excludeRegExp *regexp.Regexp
+	var err error
+	if include := c.String("include"); include != "" {
+		if includeRegExp, err = regexp.Compile(include); err != nil {
+			return fmt.Errorf("invalid --include expression: %s", err)
+		}
+	}
+	if exclude := c.String("exclude"); exclude != "" {
+		if excludeRegExp, err = regexp.Compile(exclude); err != nil {
+			return fmt.Errorf("invalid --exclude expression: %s", err)
+		}
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	resources := make(map[string]*resource)
+
+	fmt.Printf("RRD Directory = %s\n", rrdDir)
+	fmt.Printf("Pruning resources whose newest file is older than %s\n", cutoff.Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("Dry-run ? %t\n", dryRun)
+	fmt.Println("...")
+
+	// Group RRD/JRB files by their parent directory (the OpenNMS resource)
+	err = godirwalk.Walk(rrdDir, &godirwalk.Options{
+		Callback: func(path string, info *godirwalk.Dirent) error {
+			if info.IsDir() || !rrdpath.IsRRD(path) {
+				return nil
+			}
+			stat, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			dir := filepath.Dir(path)
+			res, ok := resources[dir]
+			if !ok {
+				res = &resource{dir: dir}
+				resources[dir] = res
+			}
+			res.files = append(res.files, path)
+			res.sizeInBytes += stat.Size()
+			if stat.ModTime().After(res.newestModTime) {
+				res.newestModTime = stat.ModTime()
+			}
+			return nil
+		},
+		ErrorCallback: func(osPathname string, err error) godirwalk.ErrorAction {
+			return godirwalk.SkipNode
+		},
+		Unsorted:            true,
+		FollowSymbolicLinks: true,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	data := &report{
+		debug:        debug,
+		nodeMap:      make(map[string]int),
+		interfaceMap: make(map[string]int),
+	}
+
+	var dirs []string
+	for dir := range resources {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		res := resources[dir]
+		if includeRegExp != nil && !includeRegExp.MatchString(dir) {
+			continue
+		}
+		if excludeRegExp != nil && excludeRegExp.MatchString(dir) {
+			continue
+		}
+		data.incScanned()
+		if res.newestModTime.After(cutoff) {
+			info(fmt.Sprintf("Skipping %s as its newest file was updated on %s", dir, res.newestModTime.Format("2006-01-02 15:04:05 MST")))
+			continue
+		}
+		pruneResource(dir, res, data, dryRun)
+	}
+
+	data.printResults(dryRun)
+	return nil
+}
+
+// Removes (or reports) the RRD/JRB files for a given resource along with its sibling properties files
+func pruneResource(dir string, res *resource, data *report, dryRun bool) {
+	data.incPruned()
+	data.addBytesFreed(res.sizeInBytes)
+	// Each RRD/JRB file is one group, as counted by the analysis sub-command
+	for range res.files {
+		data.incGroups()
+	}
+
+	// Match against the path plus a trailing separator since the node/interface regular expressions
+	// expect the directory to be followed by a path segment, as it would be when matched against a file.
+	dirWithSep := dir + string(filepath.Separator)
+	if nodeData := rrdpath.NodeRegExp.FindStringSubmatch(dirWithSep); len(nodeData) == 2 {
+		data.addNode(nodeData[1])
+	}
+	if intfData := rrdpath.IntfRegExp.FindStringSubmatch(dirWithSep); len(intfData) == 2 {
+		data.addIntf(intfData[1])
+	}
+
+	files := append([]string{}, res.files...)
+	if dsFile := filepath.Join(dir, dsProperties); rrdpath.FileExists(dsFile) {
+		files = append(files, dsFile)
+	}
+	if stringsFile := filepath.Join(dir, stringsProperties); rrdpath.FileExists(stringsFile) {
+		files = append(files, stringsFile)
+	}
+
+	for _, f := range files {
+		if dryRun {
+			fmt.Printf("Would remove %s\n", f)
+			continue
+		}
+		info(fmt.Sprintf("Removing %s", f))
+		if err := os.Remove(f); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: unable to remove %s: %s\n", f, err)
+		}
+	}
+}
+
+// Displays logging information only when debug is enabled
+func info(text string) {
+	if debug {
+		log.Println(text)
+	}
+}
@@ -2,16 +2,36 @@
 //
 // This tool uses the information from the analysis sub-command or the output of the Evaluation Layer.
 //
+// It sizes more than disk: it also estimates per-instance heap/off-heap memory, the minimum number of
+// instances driven by CPU and network throughput, and takes the largest of the disk/CPU/network figures
+// as the final recommendation.
+//
 // @author Alejandro Galue <agalue@opennms.com>
 package sizing
 
 import (
 	"fmt"
 	"math"
+	"strings"
 
+	"github.com/agalue/newts-sizing/pkg/report"
 	"github.com/urfave/cli"
 )
 
+// Approximate sustained writes per second a single CPU core can absorb, per engine
+const cassandraWritesPerCorePerSec = 15000
+const scyllaWritesPerCorePerSec = 50000
+
+// Overhead multiplier applied to the disk write throughput to account for gossip/repair/streaming traffic
+const networkOverheadFactor = 1.3
+
+// Defaults applied both to the flag-driven calculation and to any --config scenario that leaves
+// these fields unset
+const defaultEngine = "cassandra"
+const defaultRAMGB = 32
+const defaultCores = 8
+const defaultNetworkCapacityMbps = 1000
+
 // Command returns the CLI handler to calculate the number of nodes
 var Command = cli.Command{
 	Name:      "size",
@@ -53,54 +73,219 @@ var Command = cli.Command{
 			Usage: "The avarage number of samples per second injected to the cluster (as an alternative to total-metrics)",
 		},
 		cli.Float64Flag{
-			Name:     "disk-space, d",
-			Usage:    "The total disk space per Cassandra instance in Gigabytes",
-			Required: true,
+			Name:  "disk-space, d",
+			Usage: "The total disk space per Cassandra instance in Gigabytes; required unless --config is used",
+		},
+		cli.StringFlag{
+			Name:  "engine, E",
+			Usage: "The target engine, either `cassandra` or `scylladb`; affects the writes/sec/core assumption",
+			Value: defaultEngine,
+		},
+		cli.Float64Flag{
+			Name:  "ram, a",
+			Usage: "The total RAM available per instance in Gigabytes",
+			Value: defaultRAMGB,
+		},
+		cli.Float64Flag{
+			Name:  "cores, c",
+			Usage: "The number of CPU cores available per instance",
+			Value: defaultCores,
+		},
+		cli.Float64Flag{
+			Name:  "network-capacity, n",
+			Usage: "The sustained network throughput available per instance in Megabits per second",
+			Value: defaultNetworkCapacityMbps,
+		},
+		cli.StringFlag{
+			Name:  "report, j",
+			Usage: "Path to a JSON report produced by `analysis --report` to auto-fill --sample-size, --interval and --total-metrics",
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "Path to a YAML/HCL scenario file; when set, every scenario/year combination is calculated and compared instead of using the flags above",
 		},
 	},
 }
 
-func calculate(c *cli.Context) error {
-	ttl := c.Float64("ttl")
-	collectionInterval := c.Float64("interval")
-	averageSampleSize := c.Float64("sample-size")
-	replicationFactor := c.Float64("replication-factor")
-	percentageOverhead := c.Float64("disk-overhead")
-	totalMetrics := c.Float64("total-metrics")
-	totalDiskSpacePerNode := c.Float64("disk-space")
-	injectionRate := c.Float64("injection-rate")
-
-	if injectionRate > 0 && totalMetrics > 0 {
-		return fmt.Errorf("Please especify either the total number of metrics or the injection rate but not both")
+// Params holds every input accepted by both the flag-driven single calculation and the
+// --config-driven scenario comparison
+type Params struct {
+	TTLDays             float64
+	IntervalMinutes     float64
+	SampleSize          float64
+	ReplicationFactor   float64
+	DiskOverheadPercent float64
+	TotalMetrics        float64
+	InjectionRate       float64
+	DiskSpaceGB         float64
+	Engine              string
+	RAMGB               float64
+	Cores               float64
+	NetworkCapacityMbps float64
+}
+
+// Result holds the outcome of Calculate for a given set of Params
+type Result struct {
+	TotalMetrics  float64
+	InjectionRate float64
+	// DiskNodesRaw is the disk-driven node count before clamping to the replication factor
+	DiskNodesRaw     float64
+	DiskNodes        float64
+	CPUNodes         float64
+	NetworkNodes     float64
+	NumberOfNodes    float64
+	AvailDiskGB      float64
+	DailyGrowthGB    float64
+	HeapGB           float64
+	MemtableHeapGB   float64
+	KeyCacheGB       float64
+	WriteThroughputB float64
+}
+
+// Calculate applies the sizing formulas to a set of Params and returns the resulting Result,
+// without printing anything, so it can be reused for both a single calculation and a scenario comparison
+func Calculate(p Params) (Result, error) {
+	if p.InjectionRate > 0 && p.TotalMetrics > 0 {
+		return Result{}, fmt.Errorf("Please especify either the total number of metrics or the injection rate but not both")
 	}
 
-	fmt.Printf("All size calculations assume 1 GB = %d Bytes\n", int(math.Pow(2, 30)))
+	engine := strings.ToLower(p.Engine)
+	writesPerCorePerSec := cassandraWritesPerCorePerSec
+	if engine == "scylladb" || engine == "scylla" {
+		writesPerCorePerSec = scyllaWritesPerCorePerSec
+	} else if engine != "cassandra" {
+		return Result{}, fmt.Errorf("Unknown engine %q; expected either cassandra or scylladb", p.Engine)
+	}
 
+	totalMetrics := p.TotalMetrics
+	injectionRate := p.InjectionRate
 	if injectionRate > 0 {
-		totalMetrics = injectionRate * collectionInterval * 60
-		fmt.Printf("The calculated total number of metrics to persist every %dmin would be %d for an injection rate of %d samples/sec.\n", int(collectionInterval), int(totalMetrics), int(injectionRate))
+		totalMetrics = injectionRate * p.IntervalMinutes * 60
 	} else {
-		injectionRate = totalMetrics / (collectionInterval * 60)
-		fmt.Printf("The expected sample injection rate would be around %d samples/sec persisting data every %dmin for a total number of metrics of %d.\n", int(injectionRate), int(collectionInterval), int(totalMetrics))
+		injectionRate = totalMetrics / (p.IntervalMinutes * 60)
 	}
 
-	percentageAvailable := (1 - percentageOverhead/100)
-	totalDiskPerNodeInBytes := math.Pow(2, 30) * totalDiskSpacePerNode
-	availDiskPerNode := totalDiskSpacePerNode * percentageAvailable
-	totalSamplesPerMetric := (ttl * 86400) / (collectionInterval * 60)
+	percentageAvailable := (1 - p.DiskOverheadPercent/100)
+	totalDiskPerNodeInBytes := math.Pow(2, 30) * p.DiskSpaceGB
+	availDiskPerNode := p.DiskSpaceGB * percentageAvailable
+	totalSamplesPerMetric := (p.TTLDays * 86400) / (p.IntervalMinutes * 60)
 	sampleCapacityInBytes := totalMetrics * totalSamplesPerMetric
-	clusterUsableDiskSpace := sampleCapacityInBytes * averageSampleSize
-	numberOfNodes := (clusterUsableDiskSpace * replicationFactor) / (totalDiskPerNodeInBytes * percentageAvailable)
-	dailyGrowPerNode := (totalMetrics * (replicationFactor / numberOfNodes) * (86400 / (collectionInterval * 60))) * averageSampleSize / math.Pow(2, 30)
-
-	fmt.Printf("The total samples per metric would be %d, assuming %d bytes per sample with a replication factor of %d.\n", int(totalSamplesPerMetric), int(averageSampleSize), int(replicationFactor))
-	fmt.Printf("The available disk space in bytes per Cassandra/ScyllaDB instance would be %d GB.\n", int(availDiskPerNode))
-	fmt.Printf("The cluster sample capacity (or size per metric for %d days of TTL) in bytes would be %d (or %d GB).\n", int(ttl), int(sampleCapacityInBytes), int(sampleCapacityInBytes/math.Pow(2, 30)))
-	if numberOfNodes < replicationFactor {
-		fmt.Printf("The calculated number of Cassandra/ScyllaDB instances would be %.2f instances, but due to the chosen replication factor, it should be at least %d.\n", numberOfNodes, int(replicationFactor))
+	clusterUsableDiskSpace := sampleCapacityInBytes * p.SampleSize
+	diskNodesRaw := (clusterUsableDiskSpace * p.ReplicationFactor) / (totalDiskPerNodeInBytes * percentageAvailable)
+	diskNodes := diskNodesRaw
+	if diskNodes < p.ReplicationFactor {
+		diskNodes = p.ReplicationFactor
+	}
+
+	// CPU: assume a fixed number of sustained writes/sec per core, scaled by the replication factor
+	cpuNodes := (injectionRate * p.ReplicationFactor) / (p.Cores * float64(writesPerCorePerSec))
+
+	// RAM: heap ~ min(31 GiB, max(8 GiB, RAM/4)), memtable heap space ~ heap/4, key/row cache sized from totalMetrics
+	heapPerNode := math.Min(31, math.Max(8, p.RAMGB/4))
+	memtableHeapSpace := heapPerNode / 4
+	keyCachePerNode := math.Min(heapPerNode/10, totalMetrics*200/math.Pow(2, 30))
+
+	// Network: sustained write throughput per node derived from the disk-driven node count, with overhead for gossip/repair
+	diskWriteThroughputPerNode := (injectionRate * p.SampleSize * p.ReplicationFactor) / diskNodes
+	networkCapacityBytesPerSec := (p.NetworkCapacityMbps * 1000 * 1000) / 8
+	networkNodes := (injectionRate * p.SampleSize * p.ReplicationFactor * networkOverheadFactor) / networkCapacityBytesPerSec
+
+	numberOfNodes := math.Max(p.ReplicationFactor, math.Max(diskNodes, math.Max(cpuNodes, networkNodes)))
+	dailyGrowPerNode := (totalMetrics * (p.ReplicationFactor / numberOfNodes) * (86400 / (p.IntervalMinutes * 60))) * p.SampleSize / math.Pow(2, 30)
+
+	return Result{
+		TotalMetrics:     totalMetrics,
+		InjectionRate:    injectionRate,
+		DiskNodesRaw:     diskNodesRaw,
+		DiskNodes:        diskNodes,
+		CPUNodes:         cpuNodes,
+		NetworkNodes:     networkNodes,
+		NumberOfNodes:    numberOfNodes,
+		AvailDiskGB:      availDiskPerNode,
+		DailyGrowthGB:    dailyGrowPerNode,
+		HeapGB:           heapPerNode,
+		MemtableHeapGB:   memtableHeapSpace,
+		KeyCacheGB:       keyCachePerNode,
+		WriteThroughputB: diskWriteThroughputPerNode,
+	}, nil
+}
+
+func calculate(c *cli.Context) error {
+	if configPath := c.String("config"); configPath != "" {
+		return compareScenarios(configPath)
+	}
+
+	if !c.IsSet("disk-space") {
+		return fmt.Errorf("Please specify --disk-space, or use --config to compare scenarios")
+	}
+
+	p := Params{
+		TTLDays:             c.Float64("ttl"),
+		IntervalMinutes:     c.Float64("interval"),
+		SampleSize:          c.Float64("sample-size"),
+		ReplicationFactor:   c.Float64("replication-factor"),
+		DiskOverheadPercent: c.Float64("disk-overhead"),
+		TotalMetrics:        c.Float64("total-metrics"),
+		InjectionRate:       c.Float64("injection-rate"),
+		DiskSpaceGB:         c.Float64("disk-space"),
+		Engine:              c.String("engine"),
+		RAMGB:               c.Float64("ram"),
+		Cores:               c.Float64("cores"),
+		NetworkCapacityMbps: c.Float64("network-capacity"),
+	}
+
+	if reportPath := c.String("report"); reportPath != "" {
+		r, err := report.Read(reportPath)
+		if err != nil {
+			return fmt.Errorf("unable to read report from %s: %w", reportPath, err)
+		}
+		if !c.IsSet("sample-size") && r.AverageSampleSize > 0 {
+			p.SampleSize = r.AverageSampleSize
+		}
+		if !c.IsSet("interval") && r.IntervalMinutes > 0 {
+			p.IntervalMinutes = r.IntervalMinutes
+		}
+		if !c.IsSet("total-metrics") && !c.IsSet("injection-rate") && r.TotalMetrics > 0 {
+			p.TotalMetrics = r.TotalMetrics
+		}
+		fmt.Printf("Loaded %s: average sample size = %.2f bytes, interval = %.2f min, total metrics = %.0f\n", reportPath, r.AverageSampleSize, r.IntervalMinutes, r.TotalMetrics)
+	}
+
+	fmt.Printf("All size calculations assume 1 GB = %d Bytes\n", int(math.Pow(2, 30)))
+
+	res, err := Calculate(p)
+	if err != nil {
+		return err
+	}
+
+	if p.InjectionRate > 0 {
+		fmt.Printf("The calculated total number of metrics to persist every %dmin would be %d for an injection rate of %d samples/sec.\n", int(p.IntervalMinutes), int(res.TotalMetrics), int(p.InjectionRate))
 	} else {
-		fmt.Printf("The calculated number of Cassandra/ScyllaDB instances would be %.2f instances.\n", numberOfNodes)
+		fmt.Printf("The expected sample injection rate would be around %d samples/sec persisting data every %dmin for a total number of metrics of %d.\n", int(res.InjectionRate), int(p.IntervalMinutes), int(res.TotalMetrics))
+	}
+
+	totalSamplesPerMetric := (p.TTLDays * 86400) / (p.IntervalMinutes * 60)
+	sampleCapacityInBytes := res.TotalMetrics * totalSamplesPerMetric
+	fmt.Printf("The total samples per metric would be %d, assuming %d bytes per sample with a replication factor of %d.\n", int(totalSamplesPerMetric), int(p.SampleSize), int(p.ReplicationFactor))
+	fmt.Printf("The available disk space in bytes per Cassandra/ScyllaDB instance would be %d GB.\n", int(res.AvailDiskGB))
+	fmt.Printf("The cluster sample capacity (or size per metric for %d days of TTL) in bytes would be %d (or %d GB).\n", int(p.TTLDays), int(sampleCapacityInBytes), int(sampleCapacityInBytes/math.Pow(2, 30)))
+	if res.DiskNodesRaw < p.ReplicationFactor {
+		fmt.Printf("The disk-driven number of instances would be %.2f instances, but due to the chosen replication factor, it should be at least %d.\n", res.DiskNodesRaw, int(p.ReplicationFactor))
+	} else {
+		fmt.Printf("The disk-driven number of instances would be %.2f instances.\n", res.DiskNodesRaw)
+	}
+
+	engine := strings.ToLower(p.Engine)
+	writesPerCorePerSec := cassandraWritesPerCorePerSec
+	if engine == "scylladb" || engine == "scylla" {
+		writesPerCorePerSec = scyllaWritesPerCorePerSec
 	}
-	fmt.Printf("The daily growth in disk space per node would be %.2f GB\n", dailyGrowPerNode)
+	fmt.Printf("The CPU-driven number of instances would be %.2f instances, assuming %d writes/sec/core on %s with %d cores/instance.\n", res.CPUNodes, writesPerCorePerSec, engine, int(p.Cores))
+	fmt.Printf("The recommended JVM heap per instance would be %.2f GB (memtable_heap_space ~%.2f GB), out of %.2f GB of RAM.\n", res.HeapGB, res.MemtableHeapGB, p.RAMGB)
+	fmt.Printf("The estimated key/row cache size per instance would be %.2f GB, leaving the rest of the RAM for the off-heap page cache.\n", res.KeyCacheGB)
+	fmt.Printf("The sustained write throughput per instance would be %.2f KB/s (%.2f KB/s including gossip/repair overhead).\n", res.WriteThroughputB/1024, res.WriteThroughputB*networkOverheadFactor/1024)
+	fmt.Printf("The network-driven number of instances would be %.2f instances, assuming %.0f Mbps of sustained throughput available per instance.\n", res.NetworkNodes, p.NetworkCapacityMbps)
+	fmt.Printf("The recommended number of Cassandra/ScyllaDB instances would be %.2f instances, the largest of the disk/CPU/network figures.\n", res.NumberOfNodes)
+	fmt.Printf("The daily growth in disk space per node would be %.2f GB\n", res.DailyGrowthGB)
 	return nil
 }
@@ -0,0 +1,140 @@
+package sizing
+
+import "testing"
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name                  string
+		params                Params
+		wantErr               bool
+		wantNumberOfNodes     float64
+		wantNumberOfNodesOver float64
+	}{
+		{
+			name: "disk-driven, below replication factor clamps to it",
+			params: Params{
+				TTLDays:             365,
+				IntervalMinutes:     5,
+				SampleSize:          18,
+				ReplicationFactor:   2,
+				DiskOverheadPercent: 15,
+				TotalMetrics:        1000,
+				DiskSpaceGB:         500,
+				Engine:              "cassandra",
+				RAMGB:               32,
+				Cores:               8,
+				NetworkCapacityMbps: 1000,
+			},
+			wantNumberOfNodes: 2,
+		},
+		{
+			name: "disk-driven, above replication factor",
+			params: Params{
+				TTLDays:             365,
+				IntervalMinutes:     5,
+				SampleSize:          18,
+				ReplicationFactor:   2,
+				DiskOverheadPercent: 15,
+				TotalMetrics:        1_000_000_000,
+				DiskSpaceGB:         500,
+				Engine:              "cassandra",
+				RAMGB:               32,
+				Cores:               8,
+				NetworkCapacityMbps: 1000,
+			},
+			wantNumberOfNodesOver: 2,
+		},
+		{
+			name: "both total-metrics and injection-rate set is an error",
+			params: Params{
+				TTLDays:             365,
+				IntervalMinutes:     5,
+				SampleSize:          18,
+				ReplicationFactor:   2,
+				DiskOverheadPercent: 15,
+				TotalMetrics:        1000,
+				InjectionRate:       10,
+				DiskSpaceGB:         500,
+				Engine:              "cassandra",
+				RAMGB:               32,
+				Cores:               8,
+				NetworkCapacityMbps: 1000,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown engine is an error",
+			params: Params{
+				TTLDays:             365,
+				IntervalMinutes:     5,
+				SampleSize:          18,
+				ReplicationFactor:   2,
+				DiskOverheadPercent: 15,
+				TotalMetrics:        1000,
+				DiskSpaceGB:         500,
+				Engine:              "postgres",
+				RAMGB:               32,
+				Cores:               8,
+				NetworkCapacityMbps: 1000,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Calculate(tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Calculate() returned no error, want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Calculate() returned error: %v", err)
+			}
+			if tt.wantNumberOfNodesOver > 0 {
+				if res.NumberOfNodes <= tt.wantNumberOfNodesOver {
+					t.Errorf("NumberOfNodes = %v, want > %v", res.NumberOfNodes, tt.wantNumberOfNodesOver)
+				}
+				return
+			}
+			if res.NumberOfNodes != tt.wantNumberOfNodes {
+				t.Errorf("NumberOfNodes = %v, want %v", res.NumberOfNodes, tt.wantNumberOfNodes)
+			}
+		})
+	}
+}
+
+func TestCalculateScyllaUsesDifferentWritesPerCore(t *testing.T) {
+	base := Params{
+		TTLDays:             365,
+		IntervalMinutes:     5,
+		SampleSize:          18,
+		ReplicationFactor:   2,
+		DiskOverheadPercent: 15,
+		InjectionRate:       100000,
+		DiskSpaceGB:         500,
+		RAMGB:               32,
+		Cores:               8,
+		NetworkCapacityMbps: 1000,
+	}
+
+	cassandra := base
+	cassandra.Engine = "cassandra"
+	cassandraRes, err := Calculate(cassandra)
+	if err != nil {
+		t.Fatalf("Calculate(cassandra): %v", err)
+	}
+
+	scylla := base
+	scylla.Engine = "scylladb"
+	scyllaRes, err := Calculate(scylla)
+	if err != nil {
+		t.Fatalf("Calculate(scylladb): %v", err)
+	}
+
+	if scyllaRes.CPUNodes >= cassandraRes.CPUNodes {
+		t.Errorf("expected ScyllaDB's higher writes/core/sec to require fewer CPU-driven nodes; got scylla=%v cassandra=%v", scyllaRes.CPUNodes, cassandraRes.CPUNodes)
+	}
+}
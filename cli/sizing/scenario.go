@@ -0,0 +1,234 @@
+package sizing
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario describes a single named set of sizing inputs, optionally projected forward in time
+// via MetricsGrowthPerYear and/or TTLRampDays
+type Scenario struct {
+	Name                 string    `yaml:"name" json:"name" hcl:"name"`
+	TTLDays              float64   `yaml:"ttl_days" json:"ttl_days" hcl:"ttl_days"`
+	IntervalMinutes      float64   `yaml:"interval_minutes" json:"interval_minutes" hcl:"interval_minutes"`
+	SampleSize           float64   `yaml:"sample_size" json:"sample_size" hcl:"sample_size"`
+	ReplicationFactor    float64   `yaml:"replication_factor" json:"replication_factor" hcl:"replication_factor"`
+	DiskOverheadPercent  float64   `yaml:"disk_overhead_percent" json:"disk_overhead_percent" hcl:"disk_overhead_percent"`
+	TotalMetrics         float64   `yaml:"total_metrics" json:"total_metrics" hcl:"total_metrics"`
+	InjectionRate        float64   `yaml:"injection_rate" json:"injection_rate" hcl:"injection_rate"`
+	DiskSpaceGB          float64   `yaml:"disk_space_gb" json:"disk_space_gb" hcl:"disk_space_gb"`
+	Engine               string    `yaml:"engine" json:"engine" hcl:"engine"`
+	RAMGB                float64   `yaml:"ram_gb" json:"ram_gb" hcl:"ram_gb"`
+	Cores                float64   `yaml:"cores" json:"cores" hcl:"cores"`
+	NetworkCapacityMbps  float64   `yaml:"network_capacity_mbps" json:"network_capacity_mbps" hcl:"network_capacity_mbps"`
+	MetricsGrowthPerYear float64   `yaml:"metrics_growth_per_year" json:"metrics_growth_per_year" hcl:"metrics_growth_per_year"`
+	Years                []int     `yaml:"years" json:"years" hcl:"years"`
+	TTLRampDays          []float64 `yaml:"ttl_ramp" json:"ttl_ramp" hcl:"ttl_ramp"`
+}
+
+// ScenarioFile is the top-level document read from --config
+type ScenarioFile struct {
+	Scenarios []Scenario `yaml:"scenarios" json:"scenarios" hcl:"scenarios"`
+	// Output, when set, also writes the comparison table to this path as CSV or JSON (by extension)
+	Output string `yaml:"output" json:"output" hcl:"output"`
+}
+
+var defaultYears = []int{1, 3, 5}
+
+// loadScenarioFile reads a YAML or HCL scenario file, dispatching on its extension
+func loadScenarioFile(path string) (*ScenarioFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file ScenarioFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hcl":
+		if err := hcl.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("unable to parse HCL scenario file: %w", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("unable to parse YAML scenario file: %w", err)
+		}
+	}
+	if len(file.Scenarios) == 0 {
+		return nil, fmt.Errorf("%s does not define any scenarios", path)
+	}
+	return &file, nil
+}
+
+// scenarioRow is a single scenario/year combination, ready to be printed or exported
+type scenarioRow struct {
+	Scenario      string  `json:"scenario"`
+	Year          int     `json:"year"`
+	TTLDays       float64 `json:"ttl_days"`
+	TotalMetrics  float64 `json:"total_metrics"`
+	NumberOfNodes float64 `json:"number_of_nodes"`
+	DiskSpaceGB   float64 `json:"disk_space_gb"`
+	DailyGrowthGB float64 `json:"daily_growth_gb"`
+}
+
+// compareScenarios loads scenarios from path, runs Calculate for every scenario/year combination,
+// and prints a comparison table; it also writes CSV/JSON if the scenario file requests it
+func compareScenarios(path string) error {
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		return err
+	}
+
+	rows, err := scenarioRows(file)
+	if err != nil {
+		return err
+	}
+
+	printScenarioTable(rows)
+
+	if file.Output != "" {
+		if err := writeScenarioOutput(file.Output, rows); err != nil {
+			return fmt.Errorf("unable to write comparison output to %s: %w", file.Output, err)
+		}
+		fmt.Printf("Comparison written to %s\n", file.Output)
+	}
+	return nil
+}
+
+// scenarioRows runs Calculate for every scenario/year combination in file and returns the
+// resulting rows, without printing or exporting anything, so it can be unit tested directly
+func scenarioRows(file *ScenarioFile) ([]scenarioRow, error) {
+	var rows []scenarioRow
+	for _, s := range file.Scenarios {
+		// Mirror the flag-driven path's guards (cli/sizing/main.go's calculate requires --disk-space
+		// and refuses to set both --total-metrics and --injection-rate) so a scenario missing one of
+		// these doesn't sail through Calculate and silently divide by zero into NODES = +Inf.
+		if s.DiskSpaceGB <= 0 {
+			return nil, fmt.Errorf("scenario %q: disk_space_gb must be set to a positive value", s.Name)
+		}
+		if s.TotalMetrics > 0 && s.InjectionRate > 0 {
+			return nil, fmt.Errorf("scenario %q: specify either total_metrics or injection_rate but not both", s.Name)
+		}
+		if s.TotalMetrics == 0 && s.InjectionRate == 0 {
+			return nil, fmt.Errorf("scenario %q: must specify either total_metrics or injection_rate", s.Name)
+		}
+
+		years := s.Years
+		if len(years) == 0 {
+			years = defaultYears
+		}
+		for i, year := range years {
+			ttl := s.TTLDays
+			if i < len(s.TTLRampDays) {
+				ttl = s.TTLRampDays[i]
+			}
+			growthFactor := math.Pow(1+s.MetricsGrowthPerYear, float64(year-years[0]))
+
+			p := Params{
+				TTLDays:             ttl,
+				IntervalMinutes:     s.IntervalMinutes,
+				SampleSize:          s.SampleSize,
+				ReplicationFactor:   s.ReplicationFactor,
+				DiskOverheadPercent: s.DiskOverheadPercent,
+				TotalMetrics:        s.TotalMetrics * growthFactor,
+				InjectionRate:       s.InjectionRate * growthFactor,
+				DiskSpaceGB:         s.DiskSpaceGB,
+				Engine:              s.Engine,
+				RAMGB:               s.RAMGB,
+				Cores:               s.Cores,
+				NetworkCapacityMbps: s.NetworkCapacityMbps,
+			}
+			// A scenario file may leave these out entirely; fall back to the same defaults the
+			// `size` flags use rather than letting zero values turn into +Inf/NaN node counts
+			if p.Engine == "" {
+				p.Engine = defaultEngine
+			}
+			if p.RAMGB == 0 {
+				p.RAMGB = defaultRAMGB
+			}
+			if p.Cores == 0 {
+				p.Cores = defaultCores
+			}
+			if p.NetworkCapacityMbps == 0 {
+				p.NetworkCapacityMbps = defaultNetworkCapacityMbps
+			}
+			// Only one of TotalMetrics/InjectionRate may be set, matching the flag-driven behavior
+			if s.InjectionRate == 0 {
+				p.InjectionRate = 0
+			} else {
+				p.TotalMetrics = 0
+			}
+
+			res, err := Calculate(p)
+			if err != nil {
+				return nil, fmt.Errorf("scenario %q, year %d: %w", s.Name, year, err)
+			}
+			rows = append(rows, scenarioRow{
+				Scenario:      s.Name,
+				Year:          year,
+				TTLDays:       ttl,
+				TotalMetrics:  res.TotalMetrics,
+				NumberOfNodes: res.NumberOfNodes,
+				DiskSpaceGB:   s.DiskSpaceGB,
+				DailyGrowthGB: res.DailyGrowthGB,
+			})
+		}
+	}
+	return rows, nil
+}
+
+func printScenarioTable(rows []scenarioRow) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCENARIO\tYEAR\tTTL (DAYS)\tTOTAL METRICS\tNODES\tDISK/NODE (GB)\tDAILY GROWTH (GB)")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%.0f\t%.2f\t%.0f\t%.2f\n", r.Scenario, r.Year, r.TTLDays, r.TotalMetrics, r.NumberOfNodes, r.DiskSpaceGB, r.DailyGrowthGB)
+	}
+	w.Flush()
+}
+
+// writeScenarioOutput writes the comparison rows as CSV or JSON, dispatching on the output path's extension
+func writeScenarioOutput(path string, rows []scenarioRow) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0644)
+	default:
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cw := csv.NewWriter(f)
+		defer cw.Flush()
+		if err := cw.Write([]string{"scenario", "year", "ttl_days", "total_metrics", "number_of_nodes", "disk_space_gb", "daily_growth_gb"}); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			record := []string{
+				r.Scenario,
+				strconv.Itoa(r.Year),
+				strconv.FormatFloat(r.TTLDays, 'f', 0, 64),
+				strconv.FormatFloat(r.TotalMetrics, 'f', 0, 64),
+				strconv.FormatFloat(r.NumberOfNodes, 'f', 2, 64),
+				strconv.FormatFloat(r.DiskSpaceGB, 'f', 0, 64),
+				strconv.FormatFloat(r.DailyGrowthGB, 'f', 2, 64),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
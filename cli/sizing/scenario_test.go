@@ -0,0 +1,181 @@
+package sizing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testYAMLScenario = `
+scenarios:
+  - name: baseline
+    ttl_days: 365
+    interval_minutes: 5
+    sample_size: 18
+    replication_factor: 2
+    disk_overhead_percent: 15
+    total_metrics: 100000
+    disk_space_gb: 500
+    metrics_growth_per_year: 0.1
+    years: [1, 3]
+`
+
+const testHCLScenario = `
+scenarios = [
+  {
+    name = "baseline"
+    ttl_days = 365
+    interval_minutes = 5
+    sample_size = 18
+    replication_factor = 2
+    disk_overhead_percent = 15
+    total_metrics = 100000
+    disk_space_gb = 500
+    metrics_growth_per_year = 0.1
+    years = [1, 3]
+  }
+]
+`
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScenarioFileYAML(t *testing.T) {
+	path := writeTemp(t, "scenarios.yaml", testYAMLScenario)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+	assertScenarioLoaded(t, file)
+}
+
+func TestLoadScenarioFileHCL(t *testing.T) {
+	path := writeTemp(t, "scenarios.hcl", testHCLScenario)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+	assertScenarioLoaded(t, file)
+}
+
+func assertScenarioLoaded(t *testing.T, file *ScenarioFile) {
+	t.Helper()
+	if len(file.Scenarios) != 1 {
+		t.Fatalf("len(Scenarios) = %d, want 1", len(file.Scenarios))
+	}
+	s := file.Scenarios[0]
+	if s.Name != "baseline" || s.TTLDays != 365 || s.TotalMetrics != 100000 || s.DiskSpaceGB != 500 {
+		t.Errorf("Scenarios[0] = %+v, want name=baseline ttl_days=365 total_metrics=100000 disk_space_gb=500", s)
+	}
+	if len(s.Years) != 2 || s.Years[0] != 1 || s.Years[1] != 3 {
+		t.Errorf("Years = %v, want [1 3]", s.Years)
+	}
+}
+
+func TestLoadScenarioFileNoScenariosIsError(t *testing.T) {
+	path := writeTemp(t, "empty.yaml", "scenarios: []\n")
+	if _, err := loadScenarioFile(path); err == nil {
+		t.Fatal("loadScenarioFile() returned no error for a file with no scenarios, want one")
+	}
+}
+
+func TestScenarioRowsRejectsMissingDiskSpace(t *testing.T) {
+	path := writeTemp(t, "scenarios.yaml", `
+scenarios:
+  - name: no-disk-space
+    ttl_days: 365
+    interval_minutes: 5
+    sample_size: 18
+    replication_factor: 2
+    disk_overhead_percent: 15
+    total_metrics: 100000
+`)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+	if _, err := scenarioRows(file); err == nil {
+		t.Fatal("scenarioRows() returned no error for a scenario missing disk_space_gb, want one")
+	}
+}
+
+func TestScenarioRowsRejectsMissingMetricsSource(t *testing.T) {
+	path := writeTemp(t, "scenarios.yaml", `
+scenarios:
+  - name: no-metrics-source
+    ttl_days: 365
+    interval_minutes: 5
+    sample_size: 18
+    replication_factor: 2
+    disk_overhead_percent: 15
+    disk_space_gb: 500
+`)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+	if _, err := scenarioRows(file); err == nil {
+		t.Fatal("scenarioRows() returned no error for a scenario with neither total_metrics nor injection_rate, want one")
+	}
+}
+
+func TestCompareScenariosAppliesSizeDefaults(t *testing.T) {
+	path := writeTemp(t, "scenarios.yaml", testYAMLScenario)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+
+	s := file.Scenarios[0]
+	if s.Engine != "" || s.RAMGB != 0 || s.Cores != 0 || s.NetworkCapacityMbps != 0 {
+		t.Fatalf("expected the scenario to leave engine/ram/cores/network unset, got %+v", s)
+	}
+
+	rows, err := scenarioRows(file)
+	if err != nil {
+		t.Fatalf("scenarioRows: %v", err)
+	}
+	for _, r := range rows {
+		if math.IsInf(r.NumberOfNodes, 0) || math.IsNaN(r.NumberOfNodes) {
+			t.Fatalf("row %+v: NumberOfNodes = %v, want a finite value", r, r.NumberOfNodes)
+		}
+	}
+}
+
+func TestCompareScenariosGrowsMetricsByYear(t *testing.T) {
+	path := writeTemp(t, "scenarios.yaml", testYAMLScenario)
+	file, err := loadScenarioFile(path)
+	if err != nil {
+		t.Fatalf("loadScenarioFile: %v", err)
+	}
+
+	rows, err := scenarioRows(file)
+	if err != nil {
+		t.Fatalf("scenarioRows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("len(rows) = %d, want 2 (one per configured year)", len(rows))
+	}
+
+	year1, year3 := rows[0], rows[1]
+	if year1.Year != 1 || year3.Year != 3 {
+		t.Fatalf("rows = %+v, want years [1 3] in order", rows)
+	}
+
+	// metrics_growth_per_year: 0.1 compounds over the 2-year gap between the first and second entries
+	want := year1.TotalMetrics * math.Pow(1.1, 2)
+	if math.Abs(year3.TotalMetrics-want) > 1 {
+		t.Errorf("year 3 TotalMetrics = %v, want ~%v (year 1 grown by 1.1^2)", year3.TotalMetrics, want)
+	}
+
+	if err := compareScenarios(path); err != nil {
+		t.Fatalf("compareScenarios: %v", err)
+	}
+}
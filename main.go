@@ -8,6 +8,8 @@ import (
 	"os"
 
 	"github.com/agalue/newts-sizing/cli/analysis"
+	"github.com/agalue/newts-sizing/cli/convert"
+	"github.com/agalue/newts-sizing/cli/prune"
 	"github.com/agalue/newts-sizing/cli/sizing"
 	"github.com/urfave/cli"
 )
@@ -40,6 +42,8 @@ func initCliInfo(app *cli.App) {
 func initCliCommands(app *cli.App) {
 	app.Commands = []cli.Command{
 		analysis.Command,
+		convert.Command,
+		prune.Command,
 		sizing.Command,
 	}
 }
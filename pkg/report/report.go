@@ -0,0 +1,40 @@
+// Package report defines the JSON document the analysis sub-command writes and the sizing
+// sub-command reads, so that --sample-size, --interval and --total-metrics can be auto-filled
+// from a real RRD/JRB directory instead of being guessed on the command line.
+//
+// @author Alejandro Galue <agalue@opennms.com>
+package report
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Report is the subset of the analysis output that the sizing sub-command can consume
+type Report struct {
+	TotalMetrics      float64 `json:"totalMetrics"`
+	AverageSampleSize float64 `json:"averageSampleSize"`
+	IntervalMinutes   float64 `json:"intervalMinutes"`
+}
+
+// Write serializes the report as JSON to the given path
+func Write(path string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Read deserializes a report previously produced by Write
+func Read(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
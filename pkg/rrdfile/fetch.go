@@ -0,0 +1,98 @@
+package rrdfile
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DataPoint is a single consolidated sample read back out of an RRD/JRB file
+type DataPoint struct {
+	DS        string
+	Timestamp time.Time
+	Value     float64
+}
+
+// Fetch reads every consolidated data point between from and to for the given consolidation
+// function (e.g. "AVERAGE") by shelling out to `rrdtool fetch`. Reconstructing the RRA ring
+// buffer directly (its wrap-around cur_row pointer and per-version packing) is significantly more
+// fragile than letting rrdtool do it, so unlike Parse, Fetch does not attempt to read the native
+// binary layout itself.
+func Fetch(path, cf string, from, to time.Time) ([]DataPoint, error) {
+	if _, err := exec.LookPath("rrdtool"); err != nil {
+		return nil, fmt.Errorf("%s: rrdtool is required to fetch data points: %w", path, err)
+	}
+	out, err := exec.Command("rrdtool", "fetch", path, cf,
+		"--start", strconv.FormatInt(from.Unix(), 10),
+		"--end", strconv.FormatInt(to.Unix(), 10),
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: rrdtool fetch failed: %w", path, err)
+	}
+	return parseFetchOutput(out)
+}
+
+// parseFetchOutput parses the plain-text output of `rrdtool fetch`, e.g.:
+//
+//	           ifInOctets ifOutOctets
+//
+//	1700000000: 1.2340000000e+03 5.6780000000e+02
+//	1700000300: nan nan
+func parseFetchOutput(out []byte) ([]DataPoint, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	var dsNames []string
+	var points []DataPoint
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if dsNames == nil {
+			dsNames = strings.Fields(line)
+			continue
+		}
+		timestamp, values, err := parseFetchRow(line)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if i >= len(dsNames) {
+				break
+			}
+			points = append(points, DataPoint{DS: dsNames[i], Timestamp: timestamp, Value: v})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func parseFetchRow(line string) (time.Time, []float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return time.Time{}, nil, fmt.Errorf("malformed rrdtool fetch row: %q", line)
+	}
+	tsField := strings.TrimSuffix(fields[0], ":")
+	ts, err := strconv.ParseInt(tsField, 10, 64)
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("malformed rrdtool fetch timestamp %q: %w", fields[0], err)
+	}
+	values := make([]float64, 0, len(fields)-1)
+	for _, f := range fields[1:] {
+		if f == "nan" || f == "-nan" {
+			values = append(values, math.NaN())
+			continue
+		}
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("malformed rrdtool fetch value %q: %w", f, err)
+		}
+		values = append(values, v)
+	}
+	return time.Unix(ts, 0), values, nil
+}
@@ -0,0 +1,187 @@
+package rrdfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// writeFixedString writes s left-justified in an n-byte, nul-padded field
+func writeFixedString(buf *bytes.Buffer, s string, n int) {
+	b := make([]byte, n)
+	copy(b, s)
+	buf.Write(b)
+}
+
+// writeUTF16String writes s as n big-endian UTF-16 characters, nul-padded
+func writeUTF16String(buf *bytes.Buffer, s string, chars int) {
+	b := make([]byte, chars*2)
+	for i, c := range s {
+		if i >= chars {
+			break
+		}
+		binary.BigEndian.PutUint16(b[i*2:], uint16(c))
+	}
+	buf.Write(b)
+}
+
+// buildRRDFile assembles a minimal, but structurally valid, RRDtool v0003 native binary header
+// with one DS and one RRA, using the host's native (little-endian) byte order
+func buildRRDFile(t *testing.T, dsName, dsType string, cf string, rows, pdpStep, pdpPerRow int, xff float64, lastUpdate int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+
+	writeFixedString(&buf, "RRD", 4)  // cookie
+	writeFixedString(&buf, "0003", 5) // version
+	buf.Write(make([]byte, 7))        // alignment padding
+
+	floatCookie := make([]byte, 8)
+	binary.LittleEndian.PutUint64(floatCookie, math.Float64bits(8.642135e+130))
+	buf.Write(floatCookie)
+
+	u64 := func(v uint64) {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, v)
+		buf.Write(b)
+	}
+	u64(1)                        // ds_cnt
+	u64(1)                        // rra_cnt
+	u64(uint64(pdpStep))          // pdp_step
+	buf.Write(make([]byte, 10*8)) // stat_head_t.par[10]
+
+	writeFixedString(&buf, dsName, 20)
+	writeFixedString(&buf, dsType, 20)
+	buf.Write(make([]byte, 10*8)) // ds_def_t.par[10]
+
+	writeFixedString(&buf, cf, 20)
+	buf.Write(make([]byte, 4)) // alignment padding
+	u64(uint64(rows))
+	u64(uint64(pdpPerRow))
+	xffBits := make([]byte, 8)
+	binary.LittleEndian.PutUint64(xffBits, math.Float64bits(xff))
+	buf.Write(xffBits)
+	buf.Write(make([]byte, 9*8)) // remaining rra_def_t.par[10]
+
+	u64(uint64(lastUpdate)) // live_head_t.last_up
+	u64(0)                  // live_head_t.last_up_usec
+
+	return buf.Bytes()
+}
+
+func TestParseRRD(t *testing.T) {
+	data := buildRRDFile(t, "ifInOctets", "COUNTER", "AVERAGE", 2016, 300, 1, 0.5, 1700000000)
+
+	f, err := os.CreateTemp(t.TempDir(), "*.rrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	info, err := Parse(f.Name())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if info.Format != "rrd" {
+		t.Errorf("Format = %q, want %q", info.Format, "rrd")
+	}
+	if info.Step != 300*time.Second {
+		t.Errorf("Step = %s, want 300s", info.Step)
+	}
+	if got := info.NumericDSCount(); got != 1 {
+		t.Fatalf("NumericDSCount() = %d, want 1", got)
+	}
+	if ds := info.DataSources[0]; ds.Name != "ifInOctets" || ds.Type != "COUNTER" {
+		t.Errorf("DataSources[0] = %+v, want {ifInOctets COUNTER}", ds)
+	}
+	if len(info.Archives) != 1 {
+		t.Fatalf("len(Archives) = %d, want 1", len(info.Archives))
+	}
+	rra := info.Archives[0]
+	if rra.ConsolidationFunction != "AVERAGE" || rra.Rows != 2016 || rra.XFF != 0.5 {
+		t.Errorf("Archives[0] = %+v, want {AVERAGE 2016 0.5 ...}", rra)
+	}
+	if !info.LastUpdate.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("LastUpdate = %s, want %s", info.LastUpdate, time.Unix(1700000000, 0))
+	}
+}
+
+// buildJRBFile assembles a minimal JRobin binary header with one DS and one RRA, using the
+// big-endian, fixed-width-UTF16 layout parseJRB expects
+func buildJRBFile(t *testing.T, dsName, dsType string, cf string, rows int, step int64, xff float64, lastUpdate int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+
+	buf.Write([]byte("JRBD")) // magic
+
+	u32 := func(v uint32) {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		buf.Write(b)
+	}
+	u64 := func(v uint64) {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, v)
+		buf.Write(b)
+	}
+	u32(1) // ds count
+	u32(1) // rra count
+	u64(uint64(step))
+	u64(uint64(lastUpdate))
+
+	writeUTF16String(&buf, dsName, 20)
+	writeUTF16String(&buf, dsType, 20)
+
+	writeUTF16String(&buf, cf, 20)
+	u32(uint32(rows))
+	xffBits := make([]byte, 8)
+	binary.BigEndian.PutUint64(xffBits, math.Float64bits(xff))
+	buf.Write(xffBits)
+
+	return buf.Bytes()
+}
+
+func TestParseJRB(t *testing.T) {
+	data := buildJRBFile(t, "ifOutOctets", "COUNTER", "AVERAGE", 500, 300, 0.5, 1700000000)
+
+	f, err := os.CreateTemp(t.TempDir(), "*.jrb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	info, err := Parse(f.Name())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if info.Format != "jrb" {
+		t.Errorf("Format = %q, want %q", info.Format, "jrb")
+	}
+	if info.Step != 300*time.Second {
+		t.Errorf("Step = %s, want 300s", info.Step)
+	}
+	if got := info.NumericDSCount(); got != 1 {
+		t.Fatalf("NumericDSCount() = %d, want 1", got)
+	}
+	if ds := info.DataSources[0]; ds.Name != "ifOutOctets" || ds.Type != "COUNTER" {
+		t.Errorf("DataSources[0] = %+v, want {ifOutOctets COUNTER}", ds)
+	}
+	if len(info.Archives) != 1 {
+		t.Fatalf("len(Archives) = %d, want 1", len(info.Archives))
+	}
+	rra := info.Archives[0]
+	if rra.ConsolidationFunction != "AVERAGE" || rra.Rows != 500 || rra.XFF != 0.5 {
+		t.Errorf("Archives[0] = %+v, want {AVERAGE 500 0.5 ...}", rra)
+	}
+	if !info.LastUpdate.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("LastUpdate = %s, want %s", info.LastUpdate, time.Unix(1700000000, 0))
+	}
+}
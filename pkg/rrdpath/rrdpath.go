@@ -0,0 +1,48 @@
+// Package rrdpath holds the path-matching and reporting helpers shared by the analysis, convert
+// and prune subcommands, which all need to recognize RRD/JRB files and classify the OpenNMS
+// resources (nodes, IP interfaces) they belong to from their on-disk path.
+//
+// @author Alejandro Galue <agalue@opennms.com>
+package rrdpath
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// RRDRegExp identifies RRD or JRB files
+var RRDRegExp = regexp.MustCompile(`\.(rrd|jrb)$`)
+
+// NodeRegExp identifies node directories (Collectd), regardless if storeByForeignSource is enabled
+var NodeRegExp = regexp.MustCompile(`snmp\/(\d+|fs\/[^\/]+\/[^\/]+)\/`)
+
+// IntfRegExp identifies response time directories (Pollerd)
+var IntfRegExp = regexp.MustCompile(`response\/([\d.]+)\/`)
+
+// IsRRD returns true if the path is associated with an RRD or JRB file
+func IsRRD(path string) bool {
+	return RRDRegExp.MatchString(path)
+}
+
+// FileExists returns true if filename exists and is not a directory
+func FileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// PrintSortedMap prints a map[string]int sorted by key, one "position: key (count)" line per entry
+func PrintSortedMap(data map[string]int) {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		fmt.Printf(" %8d: %s (%d)\n", (i + 1), k, data[k])
+	}
+}